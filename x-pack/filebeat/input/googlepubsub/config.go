@@ -0,0 +1,112 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package googlepubsub
+
+import (
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// config defines the googlepubsub input's configuration options.
+type config struct {
+	common.EventMetadata `config:",inline"` // Fields and tags to add to events.
+
+	ProjectID       string             `config:"project_id" validate:"required"`
+	Topic           string             `config:"topic" validate:"required"`
+	Subscription    subscriptionConfig `config:"subscription"`
+	CredentialsFile string             `config:"credentials_file"`
+
+	// Decoding selects how the raw bytes of pubsub.Message.Data are parsed
+	// into event fields before the event is handed to the outlet.
+	Decoding decodingConfig `config:"decoding"`
+}
+
+// decodingConfig selects and configures the Decoder used to parse a
+// message's payload. See RegisterDecoder for how the codec name is
+// resolved to an implementation.
+type decodingConfig struct {
+	Codec    string                `config:"codec"` // raw (default), json, cloudevents, avro, protobuf
+	Avro     avroDecoderConfig     `config:"avro"`
+	Protobuf protobufDecoderConfig `config:"protobuf"`
+}
+
+// avroDecoderConfig configures the "avro" decoding.codec.
+type avroDecoderConfig struct {
+	Schema     string `config:"schema"`
+	SchemaFile string `config:"schema_file"`
+}
+
+// protobufDecoderConfig configures the "protobuf" decoding.codec.
+type protobufDecoderConfig struct {
+	DescriptorSetFile string `config:"descriptor_set_file"`
+	MessageName       string `config:"message_name"`
+}
+
+// subscriptionConfig defines the options that control how the input manages
+// its Pub/Sub subscription.
+type subscriptionConfig struct {
+	Name          string `config:"name" validate:"required"`
+	Create        bool   `config:"create"`
+	NumGoroutines int    `config:"num_goroutines" validate:"min=1"`
+
+	// EnableMessageOrdering enables ordering-key based delivery ordering on
+	// the subscription. This only has an effect when the subscription is
+	// created by this input (subscription.create: true) because Pub/Sub does
+	// not allow this setting to be changed on an existing subscription.
+	EnableMessageOrdering bool `config:"enable_message_ordering"`
+
+	// Filter restricts delivery to messages that match the given filter
+	// expression. Like EnableMessageOrdering this is only applied when the
+	// subscription is created by this input.
+	Filter string `config:"filter"`
+
+	// AckDeadline is the maximum time after a subscriber receives a message
+	// before it must ack or nack the message, or it will be redelivered.
+	AckDeadline time.Duration `config:"ack_deadline"`
+
+	// DeadLetter configures a dead-letter topic that the subscription
+	// forwards messages to once they have been nacked too many times.
+	DeadLetter *deadLetterConfig `config:"dead_letter"`
+
+	// MaxOutstandingMessages bounds the number of unacked messages the
+	// client will hold in memory at once. When the outlet implements
+	// ackNotifier, messages are only acked once the publishing pipeline
+	// confirms them (see pubsubInput.onAck), so this bounds the messages
+	// awaiting confirmation. channel.Outleter does not implement
+	// ackNotifier; with it, messages are acked as soon as the outlet accepts
+	// them and this setting gives no backpressure from the pipeline.
+	MaxOutstandingMessages int `config:"max_outstanding_messages"`
+
+	// MaxOutstandingBytes bounds the total size, in bytes, of unacked
+	// messages the client will hold in memory at once. The same ackNotifier
+	// caveat as for MaxOutstandingMessages applies.
+	MaxOutstandingBytes int `config:"max_outstanding_bytes"`
+}
+
+// deadLetterConfig defines the dead-letter topic settings for a subscription.
+type deadLetterConfig struct {
+	Topic string `config:"topic" validate:"required"`
+
+	// Create causes the input to create the dead-letter topic if it does
+	// not already exist.
+	Create bool `config:"create"`
+
+	// MaxDeliveryAttempts is the number of delivery attempts (ack/nack
+	// cycles) Pub/Sub will make before forwarding a message to the
+	// dead-letter topic. Pub/Sub requires a value between 5 and 100.
+	MaxDeliveryAttempts int `config:"max_delivery_attempts"`
+}
+
+func defaultConfig() config {
+	return config{
+		Subscription: subscriptionConfig{
+			NumGoroutines: 1,
+		},
+		Decoding: decodingConfig{
+			Codec: "raw",
+		},
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package googlepubsub
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/pubsub"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/option"
+)
+
+// pubsubServiceAccountFormat is the well-known identity that Pub/Sub uses to
+// publish to a dead-letter topic on a user's behalf. See
+// https://cloud.google.com/pubsub/docs/dead-letter-topics#granting_forwarding_permissions.
+const pubsubServiceAccountFormat = "serviceAccount:service-%s@gcp-sa-pubsub.iam.gserviceaccount.com"
+
+// defaultMaxDeliveryAttempts is used when subscription.dead_letter.topic is
+// set but max_delivery_attempts is left at its zero value.
+const defaultMaxDeliveryAttempts = 5
+
+// buildDeadLetterPolicy ensures the configured dead-letter topic exists
+// (creating it when requested) and returns the DeadLetterPolicy to attach to
+// the subscription being created.
+func (in *pubsubInput) buildDeadLetterPolicy(ctx context.Context, client *pubsub.Client) (*pubsub.DeadLetterPolicy, error) {
+	dl := in.Subscription.DeadLetter
+	if dl == nil {
+		return nil, nil
+	}
+
+	topic := client.Topic(dl.Topic)
+	exists, err := topic.Exists(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if dead letter topic exists: %w", err)
+	}
+	if !exists {
+		if !dl.Create {
+			return nil, fmt.Errorf("dead letter topic %v does not exist and 'subscription.dead_letter.create' is not enabled", dl.Topic)
+		}
+		if topic, err = client.CreateTopic(ctx, dl.Topic); err != nil {
+			return nil, fmt.Errorf("failed to create dead letter topic: %w", err)
+		}
+	}
+
+	if err := grantDeadLetterPublishIAM(ctx, client.Project(), topic); err != nil {
+		return nil, fmt.Errorf("failed to grant dead letter publish permissions: %w", err)
+	}
+
+	maxAttempts := dl.MaxDeliveryAttempts
+	if maxAttempts == 0 {
+		maxAttempts = defaultMaxDeliveryAttempts
+	}
+
+	return &pubsub.DeadLetterPolicy{
+		DeadLetterTopic:     topic.String(),
+		MaxDeliveryAttempts: maxAttempts,
+	}, nil
+}
+
+// grantDeadLetterPublishIAM grants the project's Pub/Sub service account
+// permission to publish to the dead-letter topic, as required by Pub/Sub.
+// It is a no-op when running against the Pub/Sub emulator, which does not
+// implement the IAM or resource manager APIs.
+func grantDeadLetterPublishIAM(ctx context.Context, projectID string, topic *pubsub.Topic) error {
+	if os.Getenv("PUBSUB_EMULATOR_HOST") != "" {
+		return nil
+	}
+
+	projectNumber, err := lookupProjectNumber(ctx, projectID)
+	if err != nil {
+		return err
+	}
+
+	member := fmt.Sprintf(pubsubServiceAccountFormat, projectNumber)
+
+	policy, err := topic.IAM().Policy(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch IAM policy: %w", err)
+	}
+	policy.Add(member, "roles/pubsub.publisher")
+	return topic.IAM().SetPolicy(ctx, policy)
+}
+
+// lookupProjectNumber resolves a GCP project ID to its numeric project
+// number, which is required to build the Pub/Sub service account identity.
+func lookupProjectNumber(ctx context.Context, projectID string) (string, error) {
+	creds, err := google.FindDefaultCredentials(ctx, cloudresourcemanager.CloudPlatformScope)
+	if err != nil {
+		return "", fmt.Errorf("failed to find default credentials: %w", err)
+	}
+
+	crmService, err := cloudresourcemanager.NewService(ctx, option.WithTokenSource(creds.TokenSource))
+	if err != nil {
+		return "", fmt.Errorf("failed to create cloudresourcemanager client: %w", err)
+	}
+
+	project, err := crmService.Projects.Get(projectID).Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to look up project number for %v: %w", projectID, err)
+	}
+	return fmt.Sprintf("%d", project.ProjectNumber), nil
+}
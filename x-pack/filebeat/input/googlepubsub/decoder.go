@@ -0,0 +1,82 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package googlepubsub
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"cloud.google.com/go/pubsub"
+
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// Decoder parses the payload of a Pub/Sub message and applies the result to
+// the beat.Event that will be published for it.
+type Decoder interface {
+	Decode(msg *pubsub.Message, event *beat.Event) error
+}
+
+// DecoderFactory builds a Decoder from the input's configuration. Factories
+// are registered under a decoding.codec name with RegisterDecoder.
+type DecoderFactory func(conf config) (Decoder, error)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]DecoderFactory{}
+)
+
+// RegisterDecoder makes a Decoder available under the given decoding.codec
+// name. It is intended to be called from an init function, including by
+// third parties that want to add support for additional payload formats.
+// It panics if the codec name is already registered.
+func RegisterDecoder(codec string, factory DecoderFactory) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	if _, exists := decoders[codec]; exists {
+		panic(fmt.Sprintf("googlepubsub: decoder already registered for codec %q", codec))
+	}
+	decoders[codec] = factory
+}
+
+// newDecoder looks up and builds the Decoder selected by conf.Decoding.Codec.
+func newDecoder(conf config) (Decoder, error) {
+	decodersMu.RLock()
+	factory, found := decoders[conf.Decoding.Codec]
+	decodersMu.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("no decoder registered for decoding.codec %q", conf.Decoding.Codec)
+	}
+	return factory(conf)
+}
+
+func init() {
+	RegisterDecoder("raw", func(config) (Decoder, error) { return rawDecoder{}, nil })
+	RegisterDecoder("json", func(config) (Decoder, error) { return jsonDecoder{}, nil })
+}
+
+// rawDecoder is the original behavior: the message body is copied verbatim
+// into the event's message field.
+type rawDecoder struct{}
+
+func (rawDecoder) Decode(msg *pubsub.Message, event *beat.Event) error {
+	event.Fields["message"] = string(msg.Data)
+	return nil
+}
+
+// jsonDecoder parses the message body as a JSON object and merges its
+// top-level fields into the event.
+type jsonDecoder struct{}
+
+func (jsonDecoder) Decode(msg *pubsub.Message, event *beat.Event) error {
+	var fields common.MapStr
+	if err := json.Unmarshal(msg.Data, &fields); err != nil {
+		return fmt.Errorf("failed to decode json payload: %w", err)
+	}
+	event.Fields.DeepUpdate(fields)
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package googlepubsub
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/linkedin/goavro/v2"
+
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func init() {
+	RegisterDecoder("avro", newAvroDecoder)
+}
+
+// avroDecoder decodes Avro binary-encoded message bodies using a single
+// schema shared by every message on the subscription.
+type avroDecoder struct {
+	codec *goavro.Codec
+}
+
+func newAvroDecoder(conf config) (Decoder, error) {
+	schema := conf.Decoding.Avro.Schema
+	if conf.Decoding.Avro.SchemaFile != "" {
+		data, err := ioutil.ReadFile(conf.Decoding.Avro.SchemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read decoding.avro.schema_file: %w", err)
+		}
+		schema = string(data)
+	}
+	if schema == "" {
+		return nil, fmt.Errorf("decoding.avro requires either 'schema' or 'schema_file'")
+	}
+
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse avro schema: %w", err)
+	}
+	return &avroDecoder{codec: codec}, nil
+}
+
+func (d *avroDecoder) Decode(msg *pubsub.Message, event *beat.Event) error {
+	native, _, err := d.codec.NativeFromBinary(msg.Data)
+	if err != nil {
+		return fmt.Errorf("failed to decode avro payload: %w", err)
+	}
+
+	record, ok := native.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("decoded avro payload is not a record")
+	}
+	event.Fields.DeepUpdate(common.MapStr(record))
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package googlepubsub
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"cloud.google.com/go/pubsub"
+
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func init() {
+	RegisterDecoder("cloudevents", func(config) (Decoder, error) { return cloudEventsDecoder{}, nil })
+}
+
+// cloudEventsDecoder parses CloudEvents v1.0 messages delivered in either
+// binary or structured content mode, per
+// https://github.com/cloudevents/spec/blob/v1.0/spec.md.
+type cloudEventsDecoder struct{}
+
+// cloudEventsEnvelope holds the subset of the CloudEvents v1.0 context
+// attributes this decoder surfaces on the event.
+type cloudEventsEnvelope struct {
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject"`
+	Time            string          `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+func (cloudEventsDecoder) Decode(msg *pubsub.Message, event *beat.Event) error {
+	var ce cloudEventsEnvelope
+
+	if msg.Attributes["Content-Type"] == "application/cloudevents+json" {
+		// Structured content mode: the whole envelope is JSON-encoded in
+		// the message body.
+		if err := json.Unmarshal(msg.Data, &ce); err != nil {
+			return fmt.Errorf("failed to decode structured-mode cloudevent: %w", err)
+		}
+	} else {
+		// Binary content mode: context attributes are carried as message
+		// attributes with a "ce-" prefix, and the body is the event data.
+		ce.ID = msg.Attributes["ce-id"]
+		ce.Source = msg.Attributes["ce-source"]
+		ce.Type = msg.Attributes["ce-type"]
+		ce.Subject = msg.Attributes["ce-subject"]
+		ce.Time = msg.Attributes["ce-time"]
+		ce.DataContentType = msg.Attributes["ce-datacontenttype"]
+		ce.Data = msg.Data
+	}
+
+	fields := common.MapStr{
+		"id":              ce.ID,
+		"source":          ce.Source,
+		"type":            ce.Type,
+		"subject":         ce.Subject,
+		"time":            ce.Time,
+		"datacontenttype": ce.DataContentType,
+	}
+
+	switch {
+	case ce.DataContentType == "application/json" && len(ce.Data) > 0:
+		var data common.MapStr
+		if err := json.Unmarshal(ce.Data, &data); err != nil {
+			return fmt.Errorf("failed to decode cloudevent json data: %w", err)
+		}
+		fields["data"] = data
+	case len(ce.Data) > 0:
+		fields["data"] = string(ce.Data)
+	}
+
+	event.Fields["cloudevents"] = fields
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package googlepubsub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func init() {
+	RegisterDecoder("protobuf", newProtobufDecoder)
+}
+
+// protobufDecoder decodes protobuf-encoded message bodies using a message
+// type resolved from a user-supplied FileDescriptorSet.
+type protobufDecoder struct {
+	msgType protoreflect.MessageType
+}
+
+func newProtobufDecoder(conf config) (Decoder, error) {
+	pbConf := conf.Decoding.Protobuf
+	if pbConf.DescriptorSetFile == "" || pbConf.MessageName == "" {
+		return nil, fmt.Errorf("decoding.protobuf requires 'descriptor_set_file' and 'message_name'")
+	}
+
+	raw, err := ioutil.ReadFile(pbConf.DescriptorSetFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read decoding.protobuf.descriptor_set_file: %w", err)
+	}
+
+	var fdSet descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(raw, &fdSet); err != nil {
+		return nil, fmt.Errorf("failed to parse protobuf descriptor set: %w", err)
+	}
+
+	files, err := protodesc.NewFiles(&fdSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build protobuf file registry: %w", err)
+	}
+
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(pbConf.MessageName))
+	if err != nil {
+		return nil, fmt.Errorf("message %q not found in descriptor set: %w", pbConf.MessageName, err)
+	}
+	msgDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a message type", pbConf.MessageName)
+	}
+
+	return &protobufDecoder{msgType: dynamicpb.NewMessageType(msgDescriptor)}, nil
+}
+
+func (d *protobufDecoder) Decode(msg *pubsub.Message, event *beat.Event) error {
+	dynMsg := d.msgType.New().Interface()
+	if err := proto.Unmarshal(msg.Data, dynMsg); err != nil {
+		return fmt.Errorf("failed to decode protobuf payload: %w", err)
+	}
+
+	jsonBytes, err := protojson.Marshal(dynMsg)
+	if err != nil {
+		return fmt.Errorf("failed to convert protobuf message to json: %w", err)
+	}
+
+	var fields common.MapStr
+	if err := json.Unmarshal(jsonBytes, &fields); err != nil {
+		return fmt.Errorf("failed to decode protobuf json representation: %w", err)
+	}
+	event.Fields.DeepUpdate(fields)
+	return nil
+}
@@ -0,0 +1,215 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package googlepubsub
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// publishRaw publishes a single message with the given body and attributes
+// and returns once Pub/Sub has assigned it an ID.
+func publishRaw(t *testing.T, client *pubsub.Client, data []byte, attrs map[string]string) {
+	t.Helper()
+	ctx := context.Background()
+	topic := client.Topic(emulatorTopic)
+
+	result := topic.Publish(ctx, &pubsub.Message{Data: data, Attributes: attrs})
+	if _, err := result.Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodingJSON(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.SetString("decoding.codec", -1, "json")
+
+	runTest(t, cfg, func(client *pubsub.Client, input *pubsubInput, out *stubOutleter, t *testing.T) {
+		createTopic(t, client)
+		createSubscription(t, client)
+		publishRaw(t, client, []byte(`{"hello":"world","count":3}`), nil)
+
+		var group errgroup.Group
+		group.Go(input.run)
+
+		events, ok := out.waitForEvents(1)
+		if !ok {
+			t.Fatalf("Expected 1 event, but got %d.", len(events))
+		}
+		input.Stop()
+
+		if err := group.Wait(); err != nil {
+			t.Fatal(err)
+		}
+
+		hello, err := events[0].Fields.GetValue("hello")
+		require.NoError(t, err)
+		assert.Equal(t, "world", hello)
+	})
+}
+
+func TestDecodingCloudEventsBinary(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.SetString("decoding.codec", -1, "cloudevents")
+
+	runTest(t, cfg, func(client *pubsub.Client, input *pubsubInput, out *stubOutleter, t *testing.T) {
+		createTopic(t, client)
+		createSubscription(t, client)
+		publishRaw(t, client, []byte(`{"temp":21.5}`), map[string]string{
+			"ce-id":              "1234",
+			"ce-source":          "/sensors/1",
+			"ce-type":            "com.example.sensor.reading",
+			"ce-specversion":     "1.0",
+			"ce-datacontenttype": "application/json",
+		})
+
+		var group errgroup.Group
+		group.Go(input.run)
+
+		events, ok := out.waitForEvents(1)
+		if !ok {
+			t.Fatalf("Expected 1 event, but got %d.", len(events))
+		}
+		input.Stop()
+
+		if err := group.Wait(); err != nil {
+			t.Fatal(err)
+		}
+
+		id, err := events[0].Fields.GetValue("cloudevents.id")
+		require.NoError(t, err)
+		assert.Equal(t, "1234", id)
+
+		temp, err := events[0].Fields.GetValue("cloudevents.data.temp")
+		require.NoError(t, err)
+		assert.EqualValues(t, 21.5, temp)
+	})
+}
+
+func TestDecodingAvro(t *testing.T) {
+	const schema = `{"type":"record","name":"Sensor","fields":[{"name":"name","type":"string"},{"name":"reading","type":"int"}]}`
+
+	codec, err := goavro.NewCodec(schema)
+	require.NoError(t, err)
+
+	binary, err := codec.BinaryFromNative(nil, map[string]interface{}{
+		"name":    "sensor-1",
+		"reading": 42,
+	})
+	require.NoError(t, err)
+
+	cfg := defaultTestConfig()
+	cfg.SetString("decoding.codec", -1, "avro")
+	cfg.SetString("decoding.avro.schema", -1, schema)
+
+	runTest(t, cfg, func(client *pubsub.Client, input *pubsubInput, out *stubOutleter, t *testing.T) {
+		createTopic(t, client)
+		createSubscription(t, client)
+		publishRaw(t, client, binary, nil)
+
+		var group errgroup.Group
+		group.Go(input.run)
+
+		events, ok := out.waitForEvents(1)
+		if !ok {
+			t.Fatalf("Expected 1 event, but got %d.", len(events))
+		}
+		input.Stop()
+
+		if err := group.Wait(); err != nil {
+			t.Fatal(err)
+		}
+
+		reading, err := events[0].Fields.GetValue("reading")
+		require.NoError(t, err)
+		assert.EqualValues(t, 42, reading)
+	})
+}
+
+func TestDecodingProtobuf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "googlepubsub-protobuf-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fdSet := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{
+			{
+				Name:    proto.String("sensor.proto"),
+				Syntax:  proto.String("proto3"),
+				Package: proto.String("googlepubsubtest"),
+				MessageType: []*descriptorpb.DescriptorProto{
+					{
+						Name: proto.String("Sensor"),
+						Field: []*descriptorpb.FieldDescriptorProto{
+							{
+								Name:     proto.String("name"),
+								Number:   proto.Int32(1),
+								Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+								Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+								JsonName: proto.String("name"),
+							},
+							{
+								Name:     proto.String("reading"),
+								Number:   proto.Int32(2),
+								Type:     descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+								Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+								JsonName: proto.String("reading"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	raw, err := proto.Marshal(fdSet)
+	require.NoError(t, err)
+	descriptorSetFile := filepath.Join(dir, "sensor.descriptorset")
+	require.NoError(t, ioutil.WriteFile(descriptorSetFile, raw, 0o600))
+
+	// Hand-encode a Sensor{name: "sensor-1", reading: 42} message using raw
+	// protobuf wire format: field 1 (string, wire type 2), field 2 (varint).
+	payload := append([]byte{0x0a, byte(len("sensor-1"))}, []byte("sensor-1")...)
+	payload = append(payload, 0x10, 42)
+
+	cfg := defaultTestConfig()
+	cfg.SetString("decoding.codec", -1, "protobuf")
+	cfg.SetString("decoding.protobuf.descriptor_set_file", -1, descriptorSetFile)
+	cfg.SetString("decoding.protobuf.message_name", -1, "googlepubsubtest.Sensor")
+
+	runTest(t, cfg, func(client *pubsub.Client, input *pubsubInput, out *stubOutleter, t *testing.T) {
+		createTopic(t, client)
+		createSubscription(t, client)
+		publishRaw(t, client, payload, nil)
+
+		var group errgroup.Group
+		group.Go(input.run)
+
+		events, ok := out.waitForEvents(1)
+		if !ok {
+			t.Fatalf("Expected 1 event, but got %d.", len(events))
+		}
+		input.Stop()
+
+		if err := group.Wait(); err != nil {
+			t.Fatal(err)
+		}
+
+		name, err := events[0].Fields.GetValue("name")
+		require.NoError(t, err)
+		assert.Equal(t, "sensor-1", name)
+	})
+}
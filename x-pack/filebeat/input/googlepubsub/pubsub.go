@@ -0,0 +1,349 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package googlepubsub implements a filebeat input that consumes messages
+// from a Google Cloud Pub/Sub subscription and publishes them as beat
+// events.
+package googlepubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/api/option"
+
+	"github.com/elastic/beats/filebeat/channel"
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/cfgwarn"
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+const inputName = "google-pubsub"
+
+func init() {
+	err := input.Register(inputName, NewInput)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// pubsubInput consumes messages from a Google Cloud Pub/Sub subscription and
+// forwards them to the libbeat publishing pipeline.
+type pubsubInput struct {
+	config
+	log      *logp.Logger
+	outlet   channel.Outleter
+	decoder  Decoder
+	inputCtx input.Context
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	workerWg sync.WaitGroup
+
+	// ackAfterConfirm is true when outlet implements ackNotifier, meaning a
+	// message is only acked once the publishing pipeline confirms it. When
+	// false (the outlet has no way to report confirmations) the input falls
+	// back to acking each message as soon as the outlet accepts it, the same
+	// as before this input supported ack-after-confirmation.
+	ackAfterConfirm bool
+
+	// pendingMu guards pendingOrder and pendingMsgs, which together track
+	// messages that have been handed to the outlet but not yet acked
+	// because the publishing pipeline hasn't confirmed them. Only used when
+	// ackAfterConfirm is true.
+	pendingMu    sync.Mutex
+	pendingOrder []string
+	pendingMsgs  map[string]*pubsub.Message
+}
+
+// Ensure pubsubInput implements the input.Input interface.
+var _ input.Input = (*pubsubInput)(nil)
+
+// NewInput creates a new Google Cloud Pub/Sub input.
+func NewInput(cfg *common.Config, connector channel.Connector, inputContext input.Context) (input.Input, error) {
+	cfgwarn.Beta("The googlepubsub input is beta")
+
+	conf := defaultConfig()
+	if err := cfg.Unpack(&conf); err != nil {
+		return nil, fmt.Errorf("failed unpacking config: %w", err)
+	}
+
+	out, err := connector(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder, err := newDecoder(conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create decoder: %w", err)
+	}
+
+	in := &pubsubInput{
+		config:      conf,
+		log:         logp.NewLogger("googlepubsub").With("project_id", conf.ProjectID, "subscription", conf.Subscription.Name),
+		outlet:      out,
+		decoder:     decoder,
+		inputCtx:    inputContext,
+		stopCh:      make(chan struct{}),
+		pendingMsgs: make(map[string]*pubsub.Message),
+	}
+
+	if notifier, ok := out.(ackNotifier); ok {
+		notifier.SetACKHandler(in.onAck)
+		in.ackAfterConfirm = true
+	} else {
+		// See the KNOWN LIMITATION note on ackNotifier: channel.Outleter (the
+		// outlet used outside of tests) doesn't implement ackNotifier, so
+		// this branch always fires for real deployments today. Logged at
+		// Warn, not just noted in a comment, so operators relying on
+		// ack-after-confirmation or on max_outstanding_messages/
+		// max_outstanding_bytes for backpressure can tell it isn't in effect.
+		in.log.Warn("outlet does not support ack-after-confirmation; " +
+			"falling back to acking each message as soon as it is handed to " +
+			"the output, the same as before this input supported " +
+			"ack-after-confirmation. subscription.max_outstanding_messages " +
+			"and subscription.max_outstanding_bytes provide no backpressure " +
+			"until the outlet can report publish confirmations.")
+	}
+
+	return in, nil
+}
+
+// Run starts the input in the background.
+func (in *pubsubInput) Run() {
+	in.workerWg.Add(1)
+	go func() {
+		defer in.workerWg.Done()
+		if err := in.run(); err != nil {
+			in.log.Error(err)
+		}
+	}()
+}
+
+// run connects to Pub/Sub, ensures the subscription exists, and receives
+// messages until the input is stopped or an unrecoverable error occurs.
+func (in *pubsubInput) run() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-in.inputCtx.Done:
+		case <-in.stopCh:
+		}
+		cancel()
+	}()
+
+	var opts []option.ClientOption
+	if in.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(in.CredentialsFile))
+	}
+
+	client, err := pubsub.NewClient(ctx, in.ProjectID, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create pubsub client: %w", err)
+	}
+	defer client.Close()
+
+	sub, err := in.getOrCreateSubscription(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	if in.Subscription.AckDeadline > 0 {
+		sub.ReceiveSettings.MaxExtension = in.Subscription.AckDeadline
+	}
+	if in.Subscription.NumGoroutines > 0 {
+		sub.ReceiveSettings.NumGoroutines = in.Subscription.NumGoroutines
+	}
+	if in.Subscription.MaxOutstandingMessages > 0 {
+		sub.ReceiveSettings.MaxOutstandingMessages = in.Subscription.MaxOutstandingMessages
+	}
+	if in.Subscription.MaxOutstandingBytes > 0 {
+		sub.ReceiveSettings.MaxOutstandingBytes = in.Subscription.MaxOutstandingBytes
+	}
+
+	// Any message still unacked when Receive returns was never confirmed by
+	// the publishing pipeline, so nack it to let Pub/Sub redeliver it.
+	defer in.nackPending()
+
+	err = sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		event := in.makeEvent(msg)
+		if !in.outlet.OnEvent(&util.Data{Event: event}) {
+			// The outlet rejected the event outright (e.g. it's shutting
+			// down); nack immediately rather than waiting for a pipeline
+			// confirmation that will never come.
+			msg.Nack()
+			return
+		}
+		if !in.ackAfterConfirm {
+			// The outlet has no way to report publishing confirmations, so
+			// fall back to acking as soon as the message is handed off.
+			msg.Ack()
+			return
+		}
+		in.enqueuePending(msg)
+	})
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to subscribe to pub/sub topic: %w", err)
+	}
+	return nil
+}
+
+// getOrCreateSubscription returns a handle to the configured subscription,
+// creating it (and verifying the topic exists) when subscription.create is
+// enabled and the subscription does not already exist.
+func (in *pubsubInput) getOrCreateSubscription(ctx context.Context, client *pubsub.Client) (*pubsub.Subscription, error) {
+	sub := client.Subscription(in.Subscription.Name)
+
+	exists, err := sub.Exists(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if subscription exists: %w", err)
+	}
+	if exists {
+		return sub, nil
+	}
+
+	if !in.Subscription.Create {
+		return nil, fmt.Errorf("no subscription exists and 'subscription.create' is not enabled")
+	}
+
+	deadLetterPolicy, err := in.buildDeadLetterPolicy(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	topic := client.Topic(in.Topic)
+	sub, err = client.CreateSubscription(ctx, in.Subscription.Name, pubsub.SubscriptionConfig{
+		Topic:                 topic,
+		EnableMessageOrdering: in.Subscription.EnableMessageOrdering,
+		Filter:                in.Subscription.Filter,
+		AckDeadline:           in.Subscription.AckDeadline,
+		DeadLetterPolicy:      deadLetterPolicy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to pub/sub topic: %w", err)
+	}
+	return sub, nil
+}
+
+// makeEvent converts a Pub/Sub message into a beat.Event, surfacing the
+// message's metadata under the gcp.pubsub.* fields and its payload as
+// decoded by the configured decoding.codec.
+func (in *pubsubInput) makeEvent(msg *pubsub.Message) beat.Event {
+	pubsubFields := common.MapStr{
+		"message_id":   msg.ID,
+		"publish_time": msg.PublishTime,
+	}
+	if len(msg.Attributes) > 0 {
+		attributes := common.MapStr{}
+		for k, v := range msg.Attributes {
+			attributes[k] = v
+		}
+		pubsubFields["attributes"] = attributes
+	}
+	if msg.OrderingKey != "" {
+		pubsubFields["ordering_key"] = msg.OrderingKey
+	}
+	if msg.DeliveryAttempt != nil {
+		pubsubFields["delivery_attempt"] = *msg.DeliveryAttempt
+	}
+
+	event := beat.Event{
+		Timestamp: msg.PublishTime,
+		Fields: common.MapStr{
+			"gcp": common.MapStr{
+				"pubsub": pubsubFields,
+			},
+		},
+	}
+	in.EventMetadata.Update(event.Fields)
+
+	if err := in.decoder.Decode(msg, &event); err != nil {
+		in.log.Errorw("failed to decode pub/sub message, falling back to raw message", "error", err, "message_id", msg.ID)
+		event.Fields["message"] = string(msg.Data)
+	}
+	return event
+}
+
+// ackNotifier is implemented by outlets that can report when events have
+// been acknowledged by the publishing pipeline, rather than merely accepted
+// into the output queue.
+//
+// KNOWN LIMITATION: channel.Outleter, the outlet implementation used by this
+// input everywhere outside of tests, does not implement ackNotifier. That
+// means real deployments of this input always take the ackAfterConfirm=false
+// path in run() today: every message is acked as soon as the outlet accepts
+// it, not once the publishing pipeline confirms it, and
+// subscription.max_outstanding_messages/max_outstanding_bytes bound nothing
+// meaningful as a result. Only the stub outlet in pubsub_test.go implements
+// ackNotifier, so only the tests exercise true ack-after-confirmation.
+// Making this work in production requires adding ackNotifier support to
+// channel.Outleter itself (e.g. reporting ACKs from the underlying
+// beat.Client), which is not part of this change; NewInput logs a Warn
+// whenever it falls back so this gap is visible at runtime, not just here.
+type ackNotifier interface {
+	// SetACKHandler registers a callback that is invoked after the
+	// publishing pipeline confirms one or more events, in the order they
+	// were handed to OnEvent. acked is the number of additional events
+	// confirmed since the previous call.
+	SetACKHandler(handler func(acked int))
+}
+
+// enqueuePending records msg as handed to the outlet but not yet confirmed
+// by the publishing pipeline.
+func (in *pubsubInput) enqueuePending(msg *pubsub.Message) {
+	in.pendingMu.Lock()
+	defer in.pendingMu.Unlock()
+	in.pendingOrder = append(in.pendingOrder, msg.ID)
+	in.pendingMsgs[msg.ID] = msg
+}
+
+// onAck is called once the publishing pipeline confirms that it has
+// published the next `acked` pending events (in order), and acks the
+// corresponding Pub/Sub messages.
+func (in *pubsubInput) onAck(acked int) {
+	in.pendingMu.Lock()
+	defer in.pendingMu.Unlock()
+
+	if acked > len(in.pendingOrder) {
+		acked = len(in.pendingOrder)
+	}
+	for _, id := range in.pendingOrder[:acked] {
+		if msg, ok := in.pendingMsgs[id]; ok {
+			msg.Ack()
+			delete(in.pendingMsgs, id)
+		}
+	}
+	in.pendingOrder = in.pendingOrder[acked:]
+}
+
+// nackPending nacks every message that is still waiting on pipeline
+// confirmation, so Pub/Sub redelivers it instead of it being lost.
+func (in *pubsubInput) nackPending() {
+	in.pendingMu.Lock()
+	defer in.pendingMu.Unlock()
+
+	for _, msg := range in.pendingMsgs {
+		msg.Nack()
+	}
+	in.pendingOrder = nil
+	in.pendingMsgs = make(map[string]*pubsub.Message)
+}
+
+// Stop stops the input and waits for the run loop to return.
+func (in *pubsubInput) Stop() {
+	in.stopOnce.Do(func() {
+		close(in.stopCh)
+	})
+	in.workerWg.Wait()
+}
+
+// Wait waits for the input to fully stop.
+func (in *pubsubInput) Wait() {
+	in.Stop()
+}
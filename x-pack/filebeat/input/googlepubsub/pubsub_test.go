@@ -27,12 +27,14 @@ import (
 	"github.com/elastic/beats/libbeat/logp"
 	"github.com/elastic/beats/libbeat/tests/compose"
 	"github.com/elastic/beats/libbeat/tests/resources"
+	"github.com/elastic/beats/x-pack/filebeat/input/googlepubsub/testutil"
 )
 
 const (
-	emulatorProjectID    = "test-project-id"
-	emulatorTopic        = "test-topic-foo"
-	emulatorSubscription = "test-subscription-bar"
+	emulatorProjectID       = "test-project-id"
+	emulatorTopic           = "test-topic-foo"
+	emulatorSubscription    = "test-subscription-bar"
+	emulatorDeadLetterTopic = "test-topic-foo-dead-letter"
 )
 
 var once sync.Once
@@ -40,19 +42,16 @@ var once sync.Once
 func testSetup(t *testing.T) *pubsub.Client {
 	t.Helper()
 
-	host := os.Getenv("PUBSUB_EMULATOR_HOST")
-	if host == "" {
-		t.Skip("PUBSUB_EMULATOR_HOST is not set in environment. You can start " +
-			"the emulator with \"docker-compose up\" from the _meta directory. " +
-			"The default address is PUBSUB_EMULATOR_HOST=localhost:8432")
-	}
-
 	if isInDockerIntegTestEnv() {
 		// We're running inside out integration test environment so
 		// make sure that that googlepubsub container is running.
 		compose.EnsureUp(t, "googlepubsub")
 	}
 
+	// Falls back to starting an emulator container (with -tags integration)
+	// or skipping the test when PUBSUB_EMULATOR_HOST isn't already set.
+	host := testutil.EnsureEmulatorRunning(t)
+
 	once.Do(func() {
 		logp.TestingSetup()
 	})
@@ -152,6 +151,26 @@ func publishMessages(t *testing.T, client *pubsub.Client, numMsgs int) []string
 	return messageIDs
 }
 
+// publishMessage publishes a single message with the given attributes and
+// ordering key (either of which may be left empty/nil) and returns its ID.
+func publishMessage(t *testing.T, client *pubsub.Client, data string, attrs map[string]string, orderingKey string) string {
+	ctx := context.Background()
+	topic := client.Topic(emulatorTopic)
+	topic.EnableMessageOrdering = true
+
+	result := topic.Publish(ctx, &pubsub.Message{
+		Data:        []byte(data),
+		Attributes:  attrs,
+		OrderingKey: orderingKey,
+	})
+
+	id, err := result.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
 func createSubscription(t *testing.T, client *pubsub.Client) {
 	ctx := context.Background()
 
@@ -236,9 +255,11 @@ func newInputContext() input.Context {
 
 type stubOutleter struct {
 	sync.Mutex
-	cond   *sync.Cond
-	done   bool
-	Events []beat.Event
+	cond       *sync.Cond
+	done       bool
+	forceNack  int
+	ackHandler func(acked int)
+	Events     []beat.Event
 }
 
 func newStubOutlet() *stubOutleter {
@@ -278,11 +299,43 @@ func (o *stubOutleter) Close() error {
 
 func (o *stubOutleter) Done() <-chan struct{} { return nil }
 
+// setForceNack causes the next n calls to OnEvent to report failure so that
+// the caller nacks the message, forcing Pub/Sub to redeliver it.
+func (o *stubOutleter) setForceNack(n int) {
+	o.Lock()
+	defer o.Unlock()
+	o.forceNack = n
+}
+
+// SetACKHandler implements ackNotifier so the input can be notified when
+// this stub's caller simulates the publishing pipeline confirming events.
+func (o *stubOutleter) SetACKHandler(handler func(acked int)) {
+	o.Lock()
+	defer o.Unlock()
+	o.ackHandler = handler
+}
+
+// ackEvents simulates the publishing pipeline confirming the next n events
+// that were handed to OnEvent.
+func (o *stubOutleter) ackEvents(n int) {
+	o.Lock()
+	handler := o.ackHandler
+	o.Unlock()
+	if handler != nil {
+		handler(n)
+	}
+}
+
 func (o *stubOutleter) OnEvent(data *util.Data) bool {
 	o.Lock()
 	defer o.Unlock()
 	o.Events = append(o.Events, data.Event)
 	o.cond.Broadcast()
+
+	if o.forceNack > 0 {
+		o.forceNack--
+		return false
+	}
 	return !o.done
 }
 
@@ -360,3 +413,300 @@ func TestSubscriptionCreate(t *testing.T) {
 		}
 	})
 }
+
+func TestSubscriptionDeadLetter(t *testing.T) {
+	const maxDeliveryAttempts = 5
+
+	cfg := defaultTestConfig()
+	cfg.SetString("subscription.dead_letter.topic", -1, emulatorDeadLetterTopic)
+	cfg.SetBool("subscription.dead_letter.create", -1, true)
+	cfg.SetInt("subscription.dead_letter.max_delivery_attempts", -1, maxDeliveryAttempts)
+
+	runTest(t, cfg, func(client *pubsub.Client, input *pubsubInput, out *stubOutleter, t *testing.T) {
+		createTopic(t, client)
+
+		// Create the dead letter topic (and a subscription to it) up front,
+		// before the input starts, so we can verify the message is actually
+		// forwarded there once it exhausts max_delivery_attempts. Creating
+		// it here doesn't stop the input from also managing it: buildDeadLetterPolicy
+		// only creates the topic when it doesn't already exist.
+		deadLetterSub := createDeadLetterSubscription(t, client, emulatorDeadLetterTopic, emulatorDeadLetterTopic+"-verify")
+
+		// Force every delivery to be nacked so Pub/Sub keeps redelivering
+		// the message until it exhausts max_delivery_attempts and forwards
+		// it to the dead-letter topic.
+		out.setForceNack(maxDeliveryAttempts)
+
+		group, ctx := errgroup.WithContext(context.Background())
+		group.Go(input.run)
+
+		time.AfterFunc(1*time.Second, ifNotDone(ctx, func() { publishMessages(t, client, 1) }))
+		time.AfterFunc(20*time.Second, func() { out.Close() })
+
+		events, ok := out.waitForEvents(maxDeliveryAttempts)
+		if !ok {
+			t.Fatalf("Expected %d delivery attempts, but got %d.", maxDeliveryAttempts, len(events))
+		}
+		input.Stop()
+
+		if err := group.Wait(); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, event := range events {
+			attempt, err := event.Fields.GetValue("gcp.pubsub.delivery_attempt")
+			if assert.NoError(t, err, "event %d is missing gcp.pubsub.delivery_attempt", i) {
+				assert.Equal(t, i+1, attempt)
+			}
+		}
+
+		// Once max_delivery_attempts is exhausted Pub/Sub stops redelivering
+		// to the subscription and forwards the message to the dead letter
+		// topic instead; confirm it actually arrives there.
+		data := pullOne(t, deadLetterSub)
+		assert.NotEmpty(t, data, "expected the message to be forwarded to the dead letter topic")
+	})
+}
+
+// createDeadLetterSubscription creates a pull subscription to the named
+// dead-letter topic (creating the topic itself if it doesn't already exist)
+// so a test can verify messages are actually forwarded there.
+func createDeadLetterSubscription(t *testing.T, client *pubsub.Client, topicName, subName string) *pubsub.Subscription {
+	ctx := context.Background()
+
+	topic := client.Topic(topicName)
+	exists, err := topic.Exists(ctx)
+	if err != nil {
+		t.Fatalf("failed to check if dead letter topic exists: %v", err)
+	}
+	if !exists {
+		if topic, err = client.CreateTopic(ctx, topicName); err != nil {
+			t.Fatalf("failed to create dead letter topic: %v", err)
+		}
+	}
+
+	sub, err := client.CreateSubscription(ctx, subName, pubsub.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatalf("failed to create dead letter subscription: %v", err)
+	}
+	return sub
+}
+
+// pullOne pulls a single message from sub, acking it, and returns its data,
+// or nil if none arrived before the timeout.
+func pullOne(t *testing.T, sub *pubsub.Subscription) []byte {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var data []byte
+	err := sub.Receive(ctx, func(_ context.Context, msg *pubsub.Message) {
+		data = msg.Data
+		msg.Ack()
+		cancel()
+	})
+	if err != nil && err != context.Canceled {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// pullDirect pulls up to numMsgs messages directly from the subscription,
+// acking each one, and returns how many were received before ctx's timeout
+// elapsed.
+func pullDirect(t *testing.T, client *pubsub.Client, numMsgs int) int {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var received int
+	var mu sync.Mutex
+	err := client.Subscription(emulatorSubscription).Receive(ctx, func(_ context.Context, msg *pubsub.Message) {
+		msg.Ack()
+		mu.Lock()
+		received++
+		done := received >= numMsgs
+		mu.Unlock()
+		if done {
+			cancel()
+		}
+	})
+	if err != nil && err != context.Canceled {
+		t.Fatal(err)
+	}
+	return received
+}
+
+func TestOutletFailureRedelivers(t *testing.T) {
+	cfg := defaultTestConfig()
+
+	runTest(t, cfg, func(client *pubsub.Client, input *pubsubInput, out *stubOutleter, t *testing.T) {
+		createTopic(t, client)
+		createSubscription(t, client)
+
+		out.setForceNack(1)
+		publishMessages(t, client, 1)
+
+		var group errgroup.Group
+		group.Go(input.run)
+
+		events, ok := out.waitForEvents(1)
+		if !ok {
+			t.Fatalf("Expected 1 event, but got %d.", len(events))
+		}
+		// The one delivery above was nacked by the stub outlet; it must be
+		// redelivered without any further help.
+		events, ok = out.waitForEvents(2)
+		if !ok {
+			t.Fatalf("Expected the message to be redelivered, but got %d events.", len(events))
+		}
+		input.Stop()
+
+		if err := group.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestNoAcksWhenStoppedMidBatch(t *testing.T) {
+	cfg := defaultTestConfig()
+
+	runTest(t, cfg, func(client *pubsub.Client, input *pubsubInput, out *stubOutleter, t *testing.T) {
+		createTopic(t, client)
+		createSubscription(t, client)
+		publishMessages(t, client, 3)
+
+		var group errgroup.Group
+		group.Go(input.run)
+
+		// The outlet accepts all 3 events but we never call out.ackEvents,
+		// simulating a publishing pipeline that hasn't confirmed them yet.
+		events, ok := out.waitForEvents(3)
+		if !ok {
+			t.Fatalf("Expected 3 events, but got %d.", len(events))
+		}
+
+		input.Stop()
+		if err := group.Wait(); err != nil {
+			t.Fatal(err)
+		}
+
+		// None of the messages were ever acked, so Pub/Sub must still have
+		// all 3 available for (re)delivery.
+		received := pullDirect(t, client, 3)
+		assert.Equal(t, 3, received)
+	})
+}
+
+func TestAckAfterConfirmation(t *testing.T) {
+	cfg := defaultTestConfig()
+
+	runTest(t, cfg, func(client *pubsub.Client, input *pubsubInput, out *stubOutleter, t *testing.T) {
+		createTopic(t, client)
+		createSubscription(t, client)
+		publishMessages(t, client, 3)
+
+		var group errgroup.Group
+		group.Go(input.run)
+
+		events, ok := out.waitForEvents(3)
+		if !ok {
+			t.Fatalf("Expected 3 events, but got %d.", len(events))
+		}
+
+		// Simulate the publishing pipeline confirming all 3 events.
+		out.ackEvents(3)
+
+		input.Stop()
+		if err := group.Wait(); err != nil {
+			t.Fatal(err)
+		}
+
+		// All 3 messages were acked, so Pub/Sub must have nothing left to
+		// (re)deliver.
+		received := pullDirect(t, client, 1)
+		assert.Equal(t, 0, received)
+	})
+}
+
+func TestMessageOrdering(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.SetBool("subscription.enable_message_ordering", -1, true)
+
+	runTest(t, cfg, func(client *pubsub.Client, input *pubsubInput, out *stubOutleter, t *testing.T) {
+		createTopic(t, client)
+
+		const orderingKey = "order-key-1"
+		want := []string{"first", "second", "third"}
+
+		group, ctx := errgroup.WithContext(context.Background())
+		group.Go(input.run)
+
+		// Publish only after the input has had time to create the
+		// subscription; messages published before it exists are not
+		// delivered to it.
+		time.AfterFunc(1*time.Second, ifNotDone(ctx, func() {
+			for _, data := range want {
+				publishMessage(t, client, data, nil, orderingKey)
+			}
+		}))
+		time.AfterFunc(10*time.Second, func() { out.Close() })
+		events, ok := out.waitForEvents(len(want))
+		if !ok {
+			t.Fatalf("Expected %d events, but got %d.", len(want), len(events))
+		}
+		input.Stop()
+
+		if err := group.Wait(); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, event := range events {
+			msg, err := event.Fields.GetValue("message")
+			if assert.NoError(t, err, "event %d is missing message", i) {
+				assert.Equal(t, want[i], msg)
+			}
+			key, err := event.Fields.GetValue("gcp.pubsub.ordering_key")
+			if assert.NoError(t, err, "event %d is missing gcp.pubsub.ordering_key", i) {
+				assert.Equal(t, orderingKey, key)
+			}
+		}
+	})
+}
+
+func TestSubscriptionFilter(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.SetString("subscription.filter", -1, `attributes.label = "wanted"`)
+
+	runTest(t, cfg, func(client *pubsub.Client, input *pubsubInput, out *stubOutleter, t *testing.T) {
+		createTopic(t, client)
+
+		var group errgroup.Group
+		group.Go(input.run)
+
+		time.AfterFunc(1*time.Second, func() {
+			publishMessage(t, client, "dropped", map[string]string{"label": "unwanted"}, "")
+			publishMessage(t, client, "kept", map[string]string{"label": "wanted"}, "")
+		})
+		time.AfterFunc(10*time.Second, func() { out.Close() })
+
+		events, ok := out.waitForEvents(1)
+		if !ok {
+			t.Fatalf("Expected 1 event, but got %d.", len(events))
+		}
+		input.Stop()
+
+		if err := group.Wait(); err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err := events[0].Fields.GetValue("message")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "kept", msg)
+		}
+		label, err := events[0].Fields.GetValue("gcp.pubsub.attributes.label")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "wanted", label)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package testutil provides a reusable Pub/Sub emulator bootstrap that
+// filebeat's googlepubsub input (and any other beat that talks to Pub/Sub)
+// can use from its tests.
+package testutil
+
+import (
+	"os"
+	"testing"
+)
+
+// EnsureEmulatorRunning makes sure a Pub/Sub emulator is reachable for the
+// calling test and returns its "host:port" address.
+//
+// If PUBSUB_EMULATOR_HOST is already set in the environment, that address is
+// returned as-is (this is the path used by the docker-integration
+// environment, where the emulator container is brought up separately via
+// compose.EnsureUp).
+//
+// Otherwise, when the test binary is built with -tags integration, an
+// emulator container is started automatically via testcontainers-go and
+// PUBSUB_EMULATOR_HOST is set for the duration of the test. Outside of
+// -tags integration builds the test is skipped with instructions for
+// starting the emulator manually.
+func EnsureEmulatorRunning(t *testing.T) string {
+	t.Helper()
+
+	if host := os.Getenv("PUBSUB_EMULATOR_HOST"); host != "" {
+		return host
+	}
+
+	host, err := startEmulator(t)
+	if err != nil {
+		t.Skipf("failed to start pubsub emulator: %v", err)
+	}
+	if host == "" {
+		t.Skip("PUBSUB_EMULATOR_HOST is not set in environment. You can start " +
+			"the emulator with \"docker-compose up\" from the _meta directory " +
+			"(the default address is PUBSUB_EMULATOR_HOST=localhost:8432), or " +
+			"run tests with -tags integration to start one automatically.")
+	}
+
+	os.Setenv("PUBSUB_EMULATOR_HOST", host)
+	t.Cleanup(func() { os.Unsetenv("PUBSUB_EMULATOR_HOST") })
+	return host
+}
@@ -0,0 +1,67 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build integration
+
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// emulatorImage is the official image that bundles the Pub/Sub emulator.
+const emulatorImage = "gcr.io/google.com/cloudsdktool/cloud-sdk:emulators"
+
+const emulatorPort = "8085/tcp"
+
+// startEmulator launches the Pub/Sub emulator in a disposable container,
+// waits for its "started" log line, and returns its host:port address. The
+// container is terminated when the test completes.
+func startEmulator(t *testing.T) (string, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        emulatorImage,
+		ExposedPorts: []string{emulatorPort},
+		Cmd: []string{
+			"gcloud", "beta", "emulators", "pubsub", "start",
+			"--host-port=0.0.0.0:8085",
+		},
+		WaitingFor: wait.ForLog("started"),
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to start pubsub emulator container: %w", err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := container.Terminate(ctx); err != nil {
+			t.Logf("failed to terminate pubsub emulator container: %v", err)
+		}
+	})
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get emulator container host: %w", err)
+	}
+	port, err := container.MappedPort(ctx, emulatorPort)
+	if err != nil {
+		return "", fmt.Errorf("failed to get emulator container port: %w", err)
+	}
+
+	return fmt.Sprintf("%s:%s", host, port.Port()), nil
+}
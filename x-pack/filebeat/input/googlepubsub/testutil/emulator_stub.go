@@ -0,0 +1,15 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package testutil
+
+import "testing"
+
+// startEmulator is a no-op outside of -tags integration builds. Callers
+// fall back to skipping the test when it returns an empty host.
+func startEmulator(t *testing.T) (string, error) {
+	return "", nil
+}